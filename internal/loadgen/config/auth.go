@@ -0,0 +1,227 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License 2.0;
+// you may not use this file except in compliance with the Elastic License 2.0.
+
+package loadgencfg
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuthProvider injects request-level authentication into outgoing requests
+// to the server. Implementations may need to refresh credentials
+// periodically (e.g. OAuth2), so Authorization is resolved per request
+// rather than once at startup.
+type AuthProvider interface {
+	// Authorization returns the value to use for the request's
+	// Authorization header, or "" if none should be set.
+	Authorization(ctx context.Context) (string, error)
+}
+
+// NewAuthProvider builds the AuthProvider for cfg, preferring, in order,
+// OAuth2 client-credentials, API key, and secret token. mTLS client
+// certificates are configured separately via TLSClientConfig, since they
+// apply at the transport level rather than as a header.
+func NewAuthProvider(cfg *configT) (AuthProvider, error) {
+	switch {
+	case cfg.OAuth2TokenURL != "":
+		return newOAuth2Provider(cfg)
+	case cfg.APIKey != "":
+		return apiKeyProvider(cfg.APIKey), nil
+	case cfg.SecretToken != "":
+		return secretTokenProvider(cfg.SecretToken), nil
+	default:
+		return noAuthProvider{}, nil
+	}
+}
+
+type noAuthProvider struct{}
+
+func (noAuthProvider) Authorization(context.Context) (string, error) { return "", nil }
+
+type secretTokenProvider string
+
+func (p secretTokenProvider) Authorization(context.Context) (string, error) {
+	return "Bearer " + string(p), nil
+}
+
+type apiKeyProvider string
+
+func (p apiKeyProvider) Authorization(context.Context) (string, error) {
+	return "ApiKey " + string(p), nil
+}
+
+// oauth2Provider implements the OAuth2 client-credentials grant, caching
+// the access token and refreshing it shortly before it expires.
+type oauth2Provider struct {
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	scopes       []string
+	httpClient   *http.Client
+
+	// cacheMu guards token/expires, which may be read by any number of
+	// concurrent callers while a refresh is in flight.
+	cacheMu sync.RWMutex
+	token   string
+	expires time.Time
+
+	// fetchMu serializes actual token fetches, so that concurrent callers
+	// racing to refresh an expired token send a single request instead of a
+	// thundering herd, without blocking callers that already have a valid
+	// cached token.
+	fetchMu sync.Mutex
+}
+
+func newOAuth2Provider(cfg *configT) (*oauth2Provider, error) {
+	if cfg.OAuth2ClientID == "" || cfg.OAuth2ClientSecret == "" {
+		return nil, fmt.Errorf("oauth2 auth requires -oauth2-client-id and -oauth2-client-secret")
+	}
+	return &oauth2Provider{
+		tokenURL:     cfg.OAuth2TokenURL,
+		clientID:     cfg.OAuth2ClientID,
+		clientSecret: cfg.OAuth2ClientSecret,
+		scopes:       cfg.OAuth2Scopes,
+		httpClient:   &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (p *oauth2Provider) Authorization(ctx context.Context) (string, error) {
+	if token, ok := p.cachedToken(); ok {
+		return "Bearer " + token, nil
+	}
+
+	p.fetchMu.Lock()
+	defer p.fetchMu.Unlock()
+
+	// Another goroutine may have already refreshed while we were waiting.
+	if token, ok := p.cachedToken(); ok {
+		return "Bearer " + token, nil
+	}
+
+	token, expires, err := p.fetchToken(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	p.cacheMu.Lock()
+	p.token = token
+	p.expires = expires
+	p.cacheMu.Unlock()
+
+	return "Bearer " + token, nil
+}
+
+func (p *oauth2Provider) cachedToken() (string, bool) {
+	p.cacheMu.RLock()
+	defer p.cacheMu.RUnlock()
+	if p.token != "" && time.Now().Before(p.expires) {
+		return p.token, true
+	}
+	return "", false
+}
+
+// fetchToken requests a new access token and returns it along with the time
+// it should be considered expired. It does not hold cacheMu or fetchMu, so
+// it must be called with fetchMu already held to avoid concurrent fetches.
+func (p *oauth2Provider) fetchToken(ctx context.Context) (token string, expires time.Time, err error) {
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {p.clientID},
+		"client_secret": {p.clientSecret},
+	}
+	if len(p.scopes) > 0 {
+		form.Set("scope", strings.Join(p.scopes, " "))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("building oauth2 token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("requesting oauth2 token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", time.Time{}, fmt.Errorf("requesting oauth2 token: unexpected status %s", resp.Status)
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", time.Time{}, fmt.Errorf("decoding oauth2 token response: %w", err)
+	}
+	if body.AccessToken == "" {
+		return "", time.Time{}, fmt.Errorf("oauth2 token response missing access_token")
+	}
+
+	// Refresh a little early to avoid racing the server's expiry, but never
+	// by more than half the token's actual lifetime, and fall back to a
+	// conservative TTL if the server didn't send expires_in at all -
+	// otherwise a 0 or short-lived token would force a fetch on every call.
+	ttl := time.Duration(body.ExpiresIn) * time.Second
+	if ttl <= 0 {
+		ttl = 60 * time.Second
+	}
+	lead := 30 * time.Second
+	if lead > ttl/2 {
+		lead = ttl / 2
+	}
+
+	return body.AccessToken, time.Now().Add(ttl - lead), nil
+}
+
+// TLSClientConfig builds the *tls.Config to use for the connection to
+// cfg.ServerURL, applying -secure, -tls-ca, -tls-server-name and, if
+// -tls-cert/-tls-key are set, a client certificate for mTLS. It returns nil
+// if no TLS customization is required.
+func TLSClientConfig(cfg *configT) (*tls.Config, error) {
+	if !cfg.Secure && cfg.TLSCA == "" && cfg.TLSCert == "" && cfg.TLSKey == "" && cfg.TLSServerName == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: !cfg.Secure,
+		ServerName:         cfg.TLSServerName,
+	}
+
+	if cfg.TLSCA != "" {
+		pem, err := os.ReadFile(cfg.TLSCA)
+		if err != nil {
+			return nil, fmt.Errorf("reading -tls-ca %s: %w", cfg.TLSCA, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in -tls-ca %s", cfg.TLSCA)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.TLSCert != "" || cfg.TLSKey != "" {
+		if cfg.TLSCert == "" || cfg.TLSKey == "" {
+			return nil, fmt.Errorf("-tls-cert and -tls-key must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate from -tls-cert/-tls-key: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
@@ -12,15 +12,35 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
-var Config struct {
+// DefaultServerURL is the server URL used when neither -server nor
+// ELASTIC_APM_SERVER_URL is set.
+const DefaultServerURL = "http://127.0.0.1:8200"
+
+// configT holds the fields of Config. It's a named (but unexported) type,
+// rather than an anonymous struct, purely so that RateFor and friends have
+// something to hang a method off; callers never need to name it.
+type configT struct {
 	ServerURL                 *url.URL
 	SecretToken               string
 	APIKey                    string
 	Secure                    bool
+	TLSCert                   string
+	TLSKey                    string
+	TLSCA                     string
+	TLSServerName             string
+	OAuth2TokenURL            string
+	OAuth2ClientID            string
+	OAuth2ClientSecret        string
+	OAuth2Scopes              []string
 	EventRate                 RateFlag
+	EventRateTransactions     RateFlag
+	EventRateSpans            RateFlag
+	EventRateMetrics          RateFlag
+	EventRateLogs             RateFlag
 	IgnoreErrors              bool
 	RewriteIDs                bool
 	RewriteTimestamps         bool
@@ -31,6 +51,95 @@ var Config struct {
 	RewriteTransactionNames   bool
 	RewriteTransactionTypes   bool
 	Headers                   map[string]string
+	Protocol                  Protocol
+	OTLPEndpoint              string
+	OTLPHeaders               map[string]string
+	LoadProfile               LoadProfileFlag
+	MetricsListen             string
+}
+
+// Config holds the live, effective configuration for the load generator. It
+// is populated from flags and environment variables at package init, and its
+// fields are updated in place, under configMu, as the -config file is
+// reloaded. Reading Config's fields directly (e.g. loadgencfg.Config.Secure)
+// is the original access pattern and keeps working unchanged; it's not
+// synchronized against a concurrent reload, which is the same trade-off this
+// package always made, before Watch existed. Call Get instead for a
+// consistent point-in-time snapshot.
+var Config configT
+
+// configMu guards writes to Config across reloads, so that a reload can't
+// race with itself; it does not make the direct-field-access pattern above
+// safe to read concurrently with a reload.
+var configMu sync.RWMutex
+
+// base is Config as derived from flags and environment variables alone,
+// captured once Watch is called (i.e. after flag.Parse, per Watch's
+// contract). Every reload re-merges the config file onto base, rather than
+// onto the previous reload's result, so that edits to the file (including
+// reverting a field back to its zero value) always take effect.
+var base configT
+
+// Get returns a point-in-time copy of the current effective configuration.
+// Unlike reading Config's fields directly, it's safe to call concurrently
+// with a reload.
+func Get() *configT {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	cfg := Config
+	return &cfg
+}
+
+// explicitFlags records which flags were actually provided, via the command
+// line or a non-empty environment variable, as opposed to merely carrying
+// their hard-coded default. It's populated by markExplicitFlags, which must
+// run after flag.Parse (Watch does this).
+//
+// This exists because some fields can't use a zero-value check to tell
+// "explicitly set to the default" apart from "never set": ServerURL always
+// ends up non-nil (it has a hard-coded default), and Protocol's default,
+// apm-http, is also a value an operator can validly pass explicitly. Without
+// this, a config file's server/protocol would be silently ignored even
+// though flags/env never actually provided one.
+var explicitFlags map[string]bool
+
+func markExplicitFlags() {
+	m := make(map[string]bool, flag.NFlag())
+	flag.Visit(func(f *flag.Flag) {
+		m[f.Name] = true
+	})
+	explicitFlags = m
+}
+
+func isExplicit(flagName string) bool {
+	return explicitFlags[flagName]
+}
+
+// Protocol identifies the wire protocol used to ship events to the remote
+// endpoint.
+type Protocol string
+
+const (
+	// ProtocolAPMHTTP sends events to APM Server's intake API over HTTP.
+	ProtocolAPMHTTP Protocol = "apm-http"
+	// ProtocolOTLPGRPC sends events as OTLP over gRPC.
+	ProtocolOTLPGRPC Protocol = "otlp-grpc"
+	// ProtocolOTLPHTTP sends events as OTLP over HTTP.
+	ProtocolOTLPHTTP Protocol = "otlp-http"
+)
+
+func (p Protocol) String() string {
+	return string(p)
+}
+
+func (p *Protocol) Set(s string) error {
+	switch Protocol(s) {
+	case ProtocolAPMHTTP, ProtocolOTLPGRPC, ProtocolOTLPHTTP:
+		*p = Protocol(s)
+		return nil
+	default:
+		return fmt.Errorf("invalid protocol %q, expected one of %q, %q, %q", s, ProtocolAPMHTTP, ProtocolOTLPGRPC, ProtocolOTLPHTTP)
+	}
 }
 
 type RateFlag struct {
@@ -69,29 +178,148 @@ func (f *RateFlag) Set(s string) error {
 	return nil
 }
 
+// Signal identifies a kind of telemetry event the generator produces.
+type Signal string
+
+const (
+	SignalTransactions Signal = "transactions"
+	SignalSpans        Signal = "spans"
+	SignalMetrics      Signal = "metrics"
+	SignalLogs         Signal = "logs"
+)
+
+// RateFor returns the configured event rate for signal, falling back to the
+// default -event-rate if no per-signal rate was set.
+func (c *configT) RateFor(signal Signal) RateFlag {
+	var rate RateFlag
+	switch signal {
+	case SignalTransactions:
+		rate = c.EventRateTransactions
+	case SignalSpans:
+		rate = c.EventRateSpans
+	case SignalMetrics:
+		rate = c.EventRateMetrics
+	case SignalLogs:
+		rate = c.EventRateLogs
+	}
+	if rate == (RateFlag{}) {
+		return c.EventRate
+	}
+	return rate
+}
+
+// Phase describes one stage of a multi-phase load profile: hold Rate for
+// Duration, optionally ramping up from the previous phase's rate.
+type Phase struct {
+	Rate     RateFlag
+	Duration time.Duration
+	// Ramp linearly interpolates the burst from the previous phase's rate
+	// up to Rate over the course of Duration, instead of switching to Rate
+	// immediately.
+	Ramp bool
+}
+
+func (p Phase) String() string {
+	s := fmt.Sprintf("%s@%s", &p.Rate, p.Duration)
+	if p.Ramp {
+		s += "+ramp"
+	}
+	return s
+}
+
+// LoadProfileFlag is an ordered sequence of Phases, parsed from a
+// comma-separated list of rate@duration entries, e.g.
+// "100/1s@30s,500/1s@2m,2000/1s@5m". A phase may be suffixed with "+ramp"
+// to linearly ramp its burst up from the previous phase's burst over its
+// duration, e.g. "2000/1s@5m+ramp", instead of switching immediately.
+type LoadProfileFlag []Phase
+
+func (f *LoadProfileFlag) String() string {
+	phases := make([]string, len(*f))
+	for i, p := range *f {
+		phases[i] = p.String()
+	}
+	return strings.Join(phases, ",")
+}
+
+func (f *LoadProfileFlag) Set(s string) error {
+	var phases LoadProfileFlag
+	for _, entry := range strings.Split(s, ",") {
+		rateStr, durStr, ok := strings.Cut(entry, "@")
+		if !ok || rateStr == "" || durStr == "" {
+			return fmt.Errorf("invalid load profile phase %q, expected format burst/interval@duration", entry)
+		}
+
+		var phase Phase
+		if err := phase.Rate.Set(rateStr); err != nil {
+			return fmt.Errorf("invalid rate in load profile phase %q: %w", entry, err)
+		}
+
+		durStr, ramp, _ := strings.Cut(durStr, "+ramp")
+		if ramp != "" {
+			return fmt.Errorf("invalid load profile phase %q: unexpected trailing %q", entry, ramp)
+		}
+		duration, err := time.ParseDuration(durStr)
+		if err != nil {
+			return fmt.Errorf("invalid duration in load profile phase %q: %w", entry, err)
+		}
+		if duration <= 0 {
+			return fmt.Errorf("invalid duration %q in load profile phase %q, must be positive", durStr, entry)
+		}
+		phase.Duration = duration
+		phase.Ramp = strings.HasSuffix(entry, "+ramp")
+
+		phases = append(phases, phase)
+	}
+
+	*f = phases
+	return nil
+}
+
 func init() {
+	cfg := &Config
+
 	// Server config
+	cfg.ServerURL, _ = url.Parse(DefaultServerURL)
 	flag.Func(
 		"server",
-		"server URL (default http://127.0.0.1:8200)",
+		fmt.Sprintf("server URL (default %s)", DefaultServerURL),
 		func(server string) (err error) {
 			if server != "" {
-				Config.ServerURL, err = url.Parse(server)
+				cfg.ServerURL, err = url.Parse(server)
 			}
 			return
 		})
-	flag.StringVar(&Config.SecretToken, "secret-token", "", "secret token for APM Server")
-	flag.StringVar(&Config.APIKey, "api-key", "", "API key for APM Server")
-	flag.BoolVar(&Config.Secure, "secure", false, "validate the remote server TLS certificates")
+	flag.StringVar(&cfg.SecretToken, "secret-token", "", "secret token for APM Server")
+	flag.StringVar(&cfg.APIKey, "api-key", "", "API key for APM Server")
+	flag.BoolVar(&cfg.Secure, "secure", false, "validate the remote server TLS certificates")
+	flag.StringVar(&cfg.TLSCert, "tls-cert", "", "path to a client TLS certificate for mTLS against the server")
+	flag.StringVar(&cfg.TLSKey, "tls-key", "", "path to the private key for -tls-cert")
+	flag.StringVar(&cfg.TLSCA, "tls-ca", "", "path to a CA certificate to verify the server against, in addition to the system pool")
+	flag.StringVar(&cfg.TLSServerName, "tls-server-name", "", "server name to use for TLS SNI and certificate verification, overriding the server URL host")
+	flag.StringVar(&cfg.OAuth2TokenURL, "oauth2-token-url", "", "token endpoint for OAuth2 client-credentials auth")
+	flag.StringVar(&cfg.OAuth2ClientID, "oauth2-client-id", "", "client ID for OAuth2 client-credentials auth")
+	flag.StringVar(&cfg.OAuth2ClientSecret, "oauth2-client-secret", "", "client secret for OAuth2 client-credentials auth")
+	flag.Func("oauth2-scopes",
+		"comma-separated OAuth2 scopes to request for client-credentials auth",
+		func(s string) error {
+			if s == "" {
+				cfg.OAuth2Scopes = nil
+				return nil
+			}
+			cfg.OAuth2Scopes = strings.Split(s, ",")
+			return nil
+		},
+	)
 	flag.BoolVar(
-		&Config.RewriteTimestamps,
+		&cfg.RewriteTimestamps,
 		"rewrite-timestamps",
 		false,
 		"rewrite event timestamps every iteration, maintaining relative offsets",
 	)
 
 	flag.BoolVar(
-		&Config.RewriteIDs,
+		&cfg.RewriteIDs,
 		"rewrite-ids",
 		false,
 		"rewrite event IDs every iteration, maintaining event relationships",
@@ -103,57 +331,117 @@ func init() {
 			if !ok {
 				return fmt.Errorf("invalid header '%s': format must be key=value", s)
 			}
-			if len(Config.Headers) == 0 {
-				Config.Headers = make(map[string]string)
+			if len(cfg.Headers) == 0 {
+				cfg.Headers = make(map[string]string)
+			}
+			cfg.Headers[k] = v
+			return nil
+		},
+	)
+	flag.Var(&cfg.EventRate, "event-rate", "Event rate in format of {burst}/{interval}. For example, 200/5s, <= 0 values evaluate to Inf (default 0/s). Used as the default for any signal without its own -event-rate-* flag")
+	flag.Var(&cfg.EventRateTransactions, "event-rate-transactions", "Event rate for transactions, in the same format as -event-rate. Defaults to -event-rate")
+	flag.Var(&cfg.EventRateSpans, "event-rate-spans", "Event rate for spans, in the same format as -event-rate. Defaults to -event-rate")
+	flag.Var(&cfg.EventRateMetrics, "event-rate-metrics", "Event rate for metrics, in the same format as -event-rate. Defaults to -event-rate")
+	flag.Var(&cfg.EventRateLogs, "event-rate-logs", "Event rate for logs, in the same format as -event-rate. Defaults to -event-rate")
+	flag.Var(&cfg.LoadProfile, "load-profile", "Comma-separated sequence of load phases in format {burst}/{interval}@{duration}, optionally suffixed with +ramp to linearly ramp up from the previous phase. For example, 100/1s@30s,500/1s@2m,2000/1s@5m+ramp. Overrides -event-rate when set")
+	flag.BoolVar(&cfg.IgnoreErrors, "ignore-errors", false, "Ignore HTTP errors while sending events")
+	cfg.Protocol = ProtocolAPMHTTP
+	flag.Var(&cfg.Protocol, "protocol", "output protocol to use: apm-http, otlp-grpc, or otlp-http (default apm-http)")
+	flag.StringVar(&cfg.OTLPEndpoint, "otlp-endpoint", "", "OTLP endpoint to send events to when -protocol is otlp-grpc or otlp-http")
+	flag.Func("otlp-headers",
+		"extra headers to send with every OTLP request, in the OTEL_EXPORTER_OTLP_HEADERS format of key1=value1,key2=value2",
+		func(s string) error {
+			headers, err := parseOTLPHeaders(s)
+			if err != nil {
+				return err
 			}
-			Config.Headers[k] = v
+			cfg.OTLPHeaders = headers
 			return nil
 		},
 	)
-	flag.Var(&Config.EventRate, "event-rate", "Event rate in format of {burst}/{interval}. For example, 200/5s, <= 0 values evaluate to Inf (default 0/s)")
-	flag.BoolVar(&Config.IgnoreErrors, "ignore-errors", false, "Ignore HTTP errors while sending events")
 
 	rewriteNames := map[string]*bool{
-		"service.name":        &Config.RewriteServiceNames,
-		"service.node.name":   &Config.RewriteServiceNodeNames,
-		"service.target.name": &Config.RewriteServiceTargetNames,
-		"span.name":           &Config.RewriteSpanNames,
-		"transaction.name":    &Config.RewriteTransactionNames,
-		"transaction.type":    &Config.RewriteTransactionTypes,
-	}
-	for field, config := range rewriteNames {
+		"service.name":        &cfg.RewriteServiceNames,
+		"service.node.name":   &cfg.RewriteServiceNodeNames,
+		"service.target.name": &cfg.RewriteServiceTargetNames,
+		"span.name":           &cfg.RewriteSpanNames,
+		"transaction.name":    &cfg.RewriteTransactionNames,
+		"transaction.type":    &cfg.RewriteTransactionTypes,
+	}
+	for field, c := range rewriteNames {
 		flag.BoolVar(
-			config,
+			c,
 			fmt.Sprintf("rewrite-%ss", strings.Replace(field, ".", "-", -1)),
 			false,
 			fmt.Sprintf("replace `%s` in events", field),
 		)
 	}
 
+	flag.StringVar(&configFile, "config", "", "path to a YAML or JSON config file to load, watched for changes and hot-reloaded while running")
+	flag.StringVar(&cfg.MetricsListen, "metrics-listen", "", "address to serve Prometheus metrics for the load generator itself on, e.g. :9090. Disabled if empty")
+
 	// For configs that can be set via environment variables, set the required
 	// flags from env if they are not explicitly provided via command line
 	setFlagsFromEnv()
 }
 
 func setFlagsFromEnv() {
-	// value[0] is environment key
-	// value[1] is default value
-	flagEnvMap := map[string][]string{
-		"server":       {"ELASTIC_APM_SERVER_URL", "http://127.0.0.1:8200"},
-		"secret-token": {"ELASTIC_APM_SECRET_TOKEN", ""},
-		"api-key":      {"ELASTIC_APM_API_KEY", ""},
-		"secure":       {"ELASTIC_APM_VERIFY_SERVER_CERT", "false"},
+	// Only apply an environment variable when it's actually set: the flags
+	// above already carry their own defaults (directly, or via flag.XxxVar's
+	// default parameter), so there's nothing to fall back to here. This also
+	// keeps flag.Visit (see markExplicitFlags) from seeing a flag as
+	// "explicitly set" just because we filled in its default.
+	flagEnvMap := map[string]string{
+		"server":       "ELASTIC_APM_SERVER_URL",
+		"secret-token": "ELASTIC_APM_SECRET_TOKEN",
+		"api-key":      "ELASTIC_APM_API_KEY",
+		"secure":       "ELASTIC_APM_VERIFY_SERVER_CERT",
+		"protocol":     "ELASTIC_APM_PROTOCOL",
+		"config":       "ELASTIC_APM_CONFIG_FILE",
+
+		"tls-cert":        "ELASTIC_APM_TLS_CERT",
+		"tls-key":         "ELASTIC_APM_TLS_KEY",
+		"tls-ca":          "ELASTIC_APM_TLS_CA",
+		"tls-server-name": "ELASTIC_APM_TLS_SERVER_NAME",
+
+		"oauth2-token-url":     "ELASTIC_APM_OAUTH2_TOKEN_URL",
+		"oauth2-client-id":     "ELASTIC_APM_OAUTH2_CLIENT_ID",
+		"oauth2-client-secret": "ELASTIC_APM_OAUTH2_CLIENT_SECRET",
+		"oauth2-scopes":        "ELASTIC_APM_OAUTH2_SCOPES",
+
+		"metrics-listen": "ELASTIC_APM_METRICS_LISTEN",
 	}
 
-	for k, v := range flagEnvMap {
-		flag.Set(k, getEnvOrDefault(v[0], v[1]))
+	for flagName, envName := range flagEnvMap {
+		if v := os.Getenv(envName); v != "" {
+			flag.Set(flagName, v)
+		}
+	}
+
+	// OTLP endpoint/headers follow the OTEL SDK's own environment variable
+	// names, rather than the ELASTIC_APM_* convention, so they're handled
+	// separately from flagEnvMap.
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); endpoint != "" {
+		flag.Set("otlp-endpoint", endpoint)
+	}
+	if headers := os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"); headers != "" {
+		flag.Set("otlp-headers", headers)
 	}
 }
 
-func getEnvOrDefault(name, defaultValue string) string {
-	value := os.Getenv(name)
-	if value != "" {
-		return value
+// parseOTLPHeaders parses headers in the OTEL_EXPORTER_OTLP_HEADERS format
+// of key1=value1,key2=value2.
+func parseOTLPHeaders(s string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, kv := range strings.Split(s, ",") {
+		if kv == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid OTLP header %q: format must be key=value", kv)
+		}
+		headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
 	}
-	return defaultValue
+	return headers, nil
 }
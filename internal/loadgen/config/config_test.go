@@ -0,0 +1,118 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License 2.0;
+// you may not use this file except in compliance with the Elastic License 2.0.
+
+package loadgencfg
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProtocolSet(t *testing.T) {
+	for _, valid := range []Protocol{ProtocolAPMHTTP, ProtocolOTLPGRPC, ProtocolOTLPHTTP} {
+		var p Protocol
+		if err := p.Set(string(valid)); err != nil {
+			t.Errorf("Set(%q) returned unexpected error: %s", valid, err)
+		}
+		if p != valid {
+			t.Errorf("Set(%q) = %q, want %q", valid, p, valid)
+		}
+	}
+
+	var p Protocol
+	if err := p.Set("otlp-carrier-pigeon"); err == nil {
+		t.Error("Set with an invalid protocol should return an error")
+	}
+}
+
+func TestParseOTLPHeaders(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    map[string]string
+		wantErr bool
+	}{
+		{in: "", want: map[string]string{}},
+		{in: "k=v", want: map[string]string{"k": "v"}},
+		{in: "k1=v1,k2=v2", want: map[string]string{"k1": "v1", "k2": "v2"}},
+		{in: " k1 = v1 , k2=v2", want: map[string]string{"k1": "v1", "k2": "v2"}},
+		{in: "noequals", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseOTLPHeaders(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseOTLPHeaders(%q): expected error, got none", tt.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseOTLPHeaders(%q): unexpected error: %s", tt.in, err)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("parseOTLPHeaders(%q) = %v, want %v", tt.in, got, tt.want)
+			continue
+		}
+		for k, v := range tt.want {
+			if got[k] != v {
+				t.Errorf("parseOTLPHeaders(%q) = %v, want %v", tt.in, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestLoadProfileFlagSet(t *testing.T) {
+	var f LoadProfileFlag
+	err := f.Set("100/1s@30s,500/1s@2m,2000/1s@5m+ramp")
+	if err != nil {
+		t.Fatalf("Set returned unexpected error: %s", err)
+	}
+	want := LoadProfileFlag{
+		{Rate: RateFlag{Burst: 100, Interval: time.Second}, Duration: 30 * time.Second},
+		{Rate: RateFlag{Burst: 500, Interval: time.Second}, Duration: 2 * time.Minute},
+		{Rate: RateFlag{Burst: 2000, Interval: time.Second}, Duration: 5 * time.Minute, Ramp: true},
+	}
+	if len(f) != len(want) {
+		t.Fatalf("Set parsed %d phases, want %d", len(f), len(want))
+	}
+	for i := range want {
+		if f[i] != want[i] {
+			t.Errorf("phase %d = %+v, want %+v", i, f[i], want[i])
+		}
+	}
+}
+
+func TestLoadProfileFlagSetErrors(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"100/1s",               // missing @duration
+		"100/1s@",              // empty duration
+		"100/1s@30s+rampextra", // trailing junk after +ramp
+		"100/1s@0s",            // non-positive duration
+		"notarate@30s",         // invalid rate
+	} {
+		var f LoadProfileFlag
+		if err := f.Set(in); err == nil {
+			t.Errorf("Set(%q): expected error, got none", in)
+		}
+	}
+}
+
+func TestConfigRateFor(t *testing.T) {
+	cfg := &configT{
+		EventRate:             RateFlag{Burst: 100, Interval: time.Second},
+		EventRateTransactions: RateFlag{Burst: 200, Interval: time.Second},
+	}
+
+	if got := cfg.RateFor(SignalTransactions); got != cfg.EventRateTransactions {
+		t.Errorf("RateFor(transactions) = %+v, want the per-signal rate %+v", got, cfg.EventRateTransactions)
+	}
+	if got := cfg.RateFor(SignalSpans); got != cfg.EventRate {
+		t.Errorf("RateFor(spans) = %+v, want the fallback %+v", got, cfg.EventRate)
+	}
+	if got := cfg.RateFor(SignalLogs); got != cfg.EventRate {
+		t.Errorf("RateFor(logs) = %+v, want the fallback %+v", got, cfg.EventRate)
+	}
+}
@@ -0,0 +1,318 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License 2.0;
+// you may not use this file except in compliance with the Elastic License 2.0.
+
+package loadgencfg
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"gopkg.in/yaml.v3"
+)
+
+// configFile is the path passed via -config/ELASTIC_APM_CONFIG_FILE, if any.
+var configFile string
+
+var (
+	subscribersMu sync.Mutex
+	subscribers   []chan *configT
+)
+
+// Subscribe registers for notifications every time the config is reloaded
+// from the file named by -config. The returned channel receives a snapshot
+// of Config after each reload; it is never closed. The channel buffers one
+// snapshot: if it still holds an undelivered one, the newer snapshot is
+// dropped for that subscriber.
+func Subscribe() <-chan *configT {
+	ch := make(chan *configT, 1)
+	subscribersMu.Lock()
+	subscribers = append(subscribers, ch)
+	subscribersMu.Unlock()
+	return ch
+}
+
+func notifySubscribers(cfg *configT) {
+	subscribersMu.Lock()
+	defer subscribersMu.Unlock()
+	for _, ch := range subscribers {
+		select {
+		case ch <- cfg:
+		default:
+		}
+	}
+}
+
+// Watch loads the config file named by -config, if set, merges it onto the
+// current Config, and watches it for subsequent changes, hot-reloading and
+// notifying subscribers on every write. It must be called after flag.Parse,
+// and returns a no-op stop function if -config was not set. The caller is
+// responsible for calling stop to release the underlying fsnotify watcher.
+func Watch() (stop func() error, err error) {
+	// base is derived from flags and environment variables alone, so it must
+	// be captured now, after flag.Parse has applied any command-line
+	// overrides onto Config - not back in init, when Config only reflected
+	// flag defaults and environment variables. markExplicitFlags similarly
+	// needs flag.Parse to have already run, so it can see which flags were
+	// actually passed on the command line.
+	markExplicitFlags()
+	configMu.RLock()
+	base = Config
+	configMu.RUnlock()
+
+	if configFile == "" {
+		return func() error { return nil }, nil
+	}
+
+	if err := reloadFile(configFile); err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("creating watcher for %s: %w", configFile, err)
+	}
+	if err := watcher.Add(filepath.Dir(configFile)); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("watching %s: %w", configFile, err)
+	}
+
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != filepath.Clean(configFile) {
+					continue
+				}
+				if event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+					continue
+				}
+				if err := reloadFile(configFile); err != nil {
+					fmt.Fprintf(os.Stderr, "loadgencfg: reloading %s: %s\n", configFile, err)
+				}
+			case _, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+			}
+		}
+	}()
+
+	return watcher.Close, nil
+}
+
+// reloadFile loads configFile, merges it onto a copy of base, and applies
+// the result onto Config, notifying subscribers.
+func reloadFile(path string) error {
+	cfg, err := loadFile(path)
+	if err != nil {
+		return err
+	}
+	configMu.Lock()
+	Config = *cfg
+	configMu.Unlock()
+	notifySubscribers(cfg)
+	return nil
+}
+
+// loadFile parses path as YAML (.yaml/.yml) or JSON (anything else) and
+// merges it onto a fresh copy of base, the config as derived from flags and
+// environment variables alone. Flags and environment variables take
+// precedence: file values only fill in fields that are still at their zero
+// value in base, except server and protocol, which the file sets unless the
+// matching flag or env var was given (see mergeInto). Starting from base rather than the previously reloaded
+// Config is what lets a later edit to the file take effect (including
+// reverting a field back to its zero value) instead of being permanently
+// shadowed by the first reload.
+func loadFile(path string) (*configT, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file %s: %w", path, err)
+	}
+
+	var fc fileConfig
+	if ext := filepath.Ext(path); ext == ".yaml" || ext == ".yml" {
+		err = yaml.Unmarshal(data, &fc)
+	} else {
+		err = json.Unmarshal(data, &fc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+
+	merged := base
+	if err := fc.mergeInto(&merged); err != nil {
+		return nil, fmt.Errorf("applying config file %s: %w", path, err)
+	}
+	return &merged, nil
+}
+
+// fileConfig mirrors Config as it's represented in the YAML/JSON config
+// file. Scalar flag-like values (rates, URLs, protocol) are kept as strings
+// so they can be parsed with the same Set methods the flags use.
+type fileConfig struct {
+	Server                    string            `yaml:"server" json:"server"`
+	SecretToken               string            `yaml:"secret_token" json:"secret_token"`
+	APIKey                    string            `yaml:"api_key" json:"api_key"`
+	Secure                    *bool             `yaml:"secure" json:"secure"`
+	TLSCert                   string            `yaml:"tls_cert" json:"tls_cert"`
+	TLSKey                    string            `yaml:"tls_key" json:"tls_key"`
+	TLSCA                     string            `yaml:"tls_ca" json:"tls_ca"`
+	TLSServerName             string            `yaml:"tls_server_name" json:"tls_server_name"`
+	OAuth2TokenURL            string            `yaml:"oauth2_token_url" json:"oauth2_token_url"`
+	OAuth2ClientID            string            `yaml:"oauth2_client_id" json:"oauth2_client_id"`
+	OAuth2ClientSecret        string            `yaml:"oauth2_client_secret" json:"oauth2_client_secret"`
+	OAuth2Scopes              []string          `yaml:"oauth2_scopes" json:"oauth2_scopes"`
+	EventRate                 string            `yaml:"event_rate" json:"event_rate"`
+	EventRateTransactions     string            `yaml:"event_rate_transactions" json:"event_rate_transactions"`
+	EventRateSpans            string            `yaml:"event_rate_spans" json:"event_rate_spans"`
+	EventRateMetrics          string            `yaml:"event_rate_metrics" json:"event_rate_metrics"`
+	EventRateLogs             string            `yaml:"event_rate_logs" json:"event_rate_logs"`
+	LoadProfile               string            `yaml:"load_profile" json:"load_profile"`
+	IgnoreErrors              *bool             `yaml:"ignore_errors" json:"ignore_errors"`
+	RewriteIDs                *bool             `yaml:"rewrite_ids" json:"rewrite_ids"`
+	RewriteTimestamps         *bool             `yaml:"rewrite_timestamps" json:"rewrite_timestamps"`
+	RewriteServiceNames       *bool             `yaml:"rewrite_service_names" json:"rewrite_service_names"`
+	RewriteServiceNodeNames   *bool             `yaml:"rewrite_service_node_names" json:"rewrite_service_node_names"`
+	RewriteServiceTargetNames *bool             `yaml:"rewrite_service_target_names" json:"rewrite_service_target_names"`
+	RewriteSpanNames          *bool             `yaml:"rewrite_span_names" json:"rewrite_span_names"`
+	RewriteTransactionNames   *bool             `yaml:"rewrite_transaction_names" json:"rewrite_transaction_names"`
+	RewriteTransactionTypes   *bool             `yaml:"rewrite_transaction_types" json:"rewrite_transaction_types"`
+	Headers                   map[string]string `yaml:"headers" json:"headers"`
+	Protocol                  string            `yaml:"protocol" json:"protocol"`
+	OTLPEndpoint              string            `yaml:"otlp_endpoint" json:"otlp_endpoint"`
+	OTLPHeaders               map[string]string `yaml:"otlp_headers" json:"otlp_headers"`
+	MetricsListen             string            `yaml:"metrics_listen" json:"metrics_listen"`
+}
+
+// mergeInto applies fc onto cfg (a copy of base), filling in fields that are
+// still at their zero value, i.e. weren't explicitly set via flag or env
+// var. Called fresh against base on every reload, so a field the file
+// leaves unset (or removes) reverts to its flag/env default rather than
+// getting stuck at whatever a previous reload set it to.
+//
+// Server and Protocol can't use the zero-value check: both have a
+// non-zero hard-coded default, so a flag/env-derived base is
+// indistinguishable from one an operator explicitly set to that same
+// default. Those two gate on isExplicit instead.
+func (fc fileConfig) mergeInto(cfg *configT) error {
+	if !isExplicit("server") && fc.Server != "" {
+		u, err := url.Parse(fc.Server)
+		if err != nil {
+			return fmt.Errorf("invalid server %q: %w", fc.Server, err)
+		}
+		cfg.ServerURL = u
+	}
+	if cfg.SecretToken == "" {
+		cfg.SecretToken = fc.SecretToken
+	}
+	if cfg.APIKey == "" {
+		cfg.APIKey = fc.APIKey
+	}
+	if !cfg.Secure && fc.Secure != nil {
+		cfg.Secure = *fc.Secure
+	}
+	if cfg.TLSCert == "" {
+		cfg.TLSCert = fc.TLSCert
+	}
+	if cfg.TLSKey == "" {
+		cfg.TLSKey = fc.TLSKey
+	}
+	if cfg.TLSCA == "" {
+		cfg.TLSCA = fc.TLSCA
+	}
+	if cfg.TLSServerName == "" {
+		cfg.TLSServerName = fc.TLSServerName
+	}
+	if cfg.OAuth2TokenURL == "" {
+		cfg.OAuth2TokenURL = fc.OAuth2TokenURL
+	}
+	if cfg.OAuth2ClientID == "" {
+		cfg.OAuth2ClientID = fc.OAuth2ClientID
+	}
+	if cfg.OAuth2ClientSecret == "" {
+		cfg.OAuth2ClientSecret = fc.OAuth2ClientSecret
+	}
+	if len(cfg.OAuth2Scopes) == 0 && len(fc.OAuth2Scopes) > 0 {
+		cfg.OAuth2Scopes = fc.OAuth2Scopes
+	}
+	if cfg.EventRate == (RateFlag{}) && fc.EventRate != "" {
+		if err := cfg.EventRate.Set(fc.EventRate); err != nil {
+			return fmt.Errorf("invalid event_rate %q: %w", fc.EventRate, err)
+		}
+	}
+	for _, r := range []struct {
+		rate *RateFlag
+		s    string
+		name string
+	}{
+		{&cfg.EventRateTransactions, fc.EventRateTransactions, "event_rate_transactions"},
+		{&cfg.EventRateSpans, fc.EventRateSpans, "event_rate_spans"},
+		{&cfg.EventRateMetrics, fc.EventRateMetrics, "event_rate_metrics"},
+		{&cfg.EventRateLogs, fc.EventRateLogs, "event_rate_logs"},
+	} {
+		if *r.rate == (RateFlag{}) && r.s != "" {
+			if err := r.rate.Set(r.s); err != nil {
+				return fmt.Errorf("invalid %s %q: %w", r.name, r.s, err)
+			}
+		}
+	}
+	if len(cfg.LoadProfile) == 0 && fc.LoadProfile != "" {
+		if err := cfg.LoadProfile.Set(fc.LoadProfile); err != nil {
+			return fmt.Errorf("invalid load_profile %q: %w", fc.LoadProfile, err)
+		}
+	}
+	if !cfg.IgnoreErrors && fc.IgnoreErrors != nil {
+		cfg.IgnoreErrors = *fc.IgnoreErrors
+	}
+	if !cfg.RewriteIDs && fc.RewriteIDs != nil {
+		cfg.RewriteIDs = *fc.RewriteIDs
+	}
+	if !cfg.RewriteTimestamps && fc.RewriteTimestamps != nil {
+		cfg.RewriteTimestamps = *fc.RewriteTimestamps
+	}
+	if !cfg.RewriteServiceNames && fc.RewriteServiceNames != nil {
+		cfg.RewriteServiceNames = *fc.RewriteServiceNames
+	}
+	if !cfg.RewriteServiceNodeNames && fc.RewriteServiceNodeNames != nil {
+		cfg.RewriteServiceNodeNames = *fc.RewriteServiceNodeNames
+	}
+	if !cfg.RewriteServiceTargetNames && fc.RewriteServiceTargetNames != nil {
+		cfg.RewriteServiceTargetNames = *fc.RewriteServiceTargetNames
+	}
+	if !cfg.RewriteSpanNames && fc.RewriteSpanNames != nil {
+		cfg.RewriteSpanNames = *fc.RewriteSpanNames
+	}
+	if !cfg.RewriteTransactionNames && fc.RewriteTransactionNames != nil {
+		cfg.RewriteTransactionNames = *fc.RewriteTransactionNames
+	}
+	if !cfg.RewriteTransactionTypes && fc.RewriteTransactionTypes != nil {
+		cfg.RewriteTransactionTypes = *fc.RewriteTransactionTypes
+	}
+	if len(cfg.Headers) == 0 && len(fc.Headers) > 0 {
+		cfg.Headers = fc.Headers
+	}
+	if !isExplicit("protocol") && fc.Protocol != "" {
+		if err := cfg.Protocol.Set(fc.Protocol); err != nil {
+			return fmt.Errorf("invalid protocol %q: %w", fc.Protocol, err)
+		}
+	}
+	if cfg.OTLPEndpoint == "" {
+		cfg.OTLPEndpoint = fc.OTLPEndpoint
+	}
+	if len(cfg.OTLPHeaders) == 0 && len(fc.OTLPHeaders) > 0 {
+		cfg.OTLPHeaders = fc.OTLPHeaders
+	}
+	if cfg.MetricsListen == "" {
+		cfg.MetricsListen = fc.MetricsListen
+	}
+	return nil
+}
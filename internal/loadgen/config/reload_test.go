@@ -0,0 +1,187 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License 2.0;
+// you may not use this file except in compliance with the Elastic License 2.0.
+
+package loadgencfg
+
+import (
+	"net/url"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMergeIntoFillsZeroValueFields(t *testing.T) {
+	cfg := &configT{}
+	secure := true
+	fc := fileConfig{
+		SecretToken: "file-token",
+		Secure:      &secure,
+		EventRate:   "100/1s",
+		Headers:     map[string]string{"X-From-File": "1"},
+	}
+
+	if err := fc.mergeInto(cfg); err != nil {
+		t.Fatalf("mergeInto returned unexpected error: %s", err)
+	}
+	if cfg.SecretToken != "file-token" {
+		t.Errorf("SecretToken = %q, want %q", cfg.SecretToken, "file-token")
+	}
+	if !cfg.Secure {
+		t.Error("Secure = false, want true")
+	}
+	if cfg.EventRate != (RateFlag{Burst: 100, Interval: time.Second}) {
+		t.Errorf("EventRate = %+v, want 100/1s", cfg.EventRate)
+	}
+	if cfg.Headers["X-From-File"] != "1" {
+		t.Errorf("Headers = %v, missing X-From-File", cfg.Headers)
+	}
+}
+
+func TestMergeIntoFillsTLSAndOAuth2Fields(t *testing.T) {
+	cfg := &configT{}
+	fc := fileConfig{
+		TLSCert:            "cert.pem",
+		TLSKey:             "key.pem",
+		TLSCA:              "ca.pem",
+		TLSServerName:      "apm.example.com",
+		OAuth2TokenURL:     "https://auth.example.com/token",
+		OAuth2ClientID:     "client-id",
+		OAuth2ClientSecret: "client-secret",
+		OAuth2Scopes:       []string{"metrics.write", "traces.write"},
+	}
+
+	if err := fc.mergeInto(cfg); err != nil {
+		t.Fatalf("mergeInto returned unexpected error: %s", err)
+	}
+	if cfg.TLSCert != fc.TLSCert || cfg.TLSKey != fc.TLSKey || cfg.TLSCA != fc.TLSCA || cfg.TLSServerName != fc.TLSServerName {
+		t.Errorf("TLS fields = %+v, want %+v", cfg, fc)
+	}
+	if cfg.OAuth2TokenURL != fc.OAuth2TokenURL || cfg.OAuth2ClientID != fc.OAuth2ClientID || cfg.OAuth2ClientSecret != fc.OAuth2ClientSecret {
+		t.Errorf("OAuth2 fields = %+v, want %+v", cfg, fc)
+	}
+	if len(cfg.OAuth2Scopes) != 2 || cfg.OAuth2Scopes[0] != "metrics.write" || cfg.OAuth2Scopes[1] != "traces.write" {
+		t.Errorf("OAuth2Scopes = %v, want %v", cfg.OAuth2Scopes, fc.OAuth2Scopes)
+	}
+}
+
+func TestMergeIntoDoesNotOverrideExplicitlySetFields(t *testing.T) {
+	cfg := &configT{SecretToken: "flag-token"}
+	fc := fileConfig{SecretToken: "file-token"}
+
+	if err := fc.mergeInto(cfg); err != nil {
+		t.Fatalf("mergeInto returned unexpected error: %s", err)
+	}
+	if cfg.SecretToken != "flag-token" {
+		t.Errorf("SecretToken = %q, want the flag-set value %q to win over the file", cfg.SecretToken, "flag-token")
+	}
+}
+
+// TestMergeIntoServerFileOverridesHardCodedDefault is a regression test:
+// ServerURL is never nil in base (it has a hard-coded default), so
+// mergeInto must not use a zero-value check to decide whether the file's
+// server key applies - it must apply whenever -server/ELASTIC_APM_SERVER_URL
+// were never actually provided, default or not.
+func TestMergeIntoServerFileOverridesHardCodedDefault(t *testing.T) {
+	oldExplicit := explicitFlags
+	t.Cleanup(func() { explicitFlags = oldExplicit })
+	explicitFlags = nil
+
+	defaultURL, err := url.Parse(DefaultServerURL)
+	if err != nil {
+		t.Fatalf("parsing DefaultServerURL: %s", err)
+	}
+	cfg := &configT{ServerURL: defaultURL}
+	fc := fileConfig{Server: "https://prod-apm.example.com:8200"}
+
+	if err := fc.mergeInto(cfg); err != nil {
+		t.Fatalf("mergeInto returned unexpected error: %s", err)
+	}
+	if cfg.ServerURL.String() != fc.Server {
+		t.Errorf("ServerURL = %q, want the file value %q to win over the hard-coded default", cfg.ServerURL, fc.Server)
+	}
+}
+
+// TestMergeIntoDoesNotOverrideExplicitServerOrProtocol covers the two fields
+// mergeInto can't gate on a zero-value check for: Server and Protocol both
+// have non-zero hard-coded defaults, so an explicitly-set flag/env value
+// must win over the file even when it equals that default.
+func TestMergeIntoDoesNotOverrideExplicitServerOrProtocol(t *testing.T) {
+	oldExplicit := explicitFlags
+	t.Cleanup(func() { explicitFlags = oldExplicit })
+	explicitFlags = map[string]bool{"server": true, "protocol": true}
+
+	defaultURL, err := url.Parse(DefaultServerURL)
+	if err != nil {
+		t.Fatalf("parsing DefaultServerURL: %s", err)
+	}
+	cfg := &configT{ServerURL: defaultURL, Protocol: ProtocolAPMHTTP}
+	fc := fileConfig{Server: "https://prod-apm.example.com:8200", Protocol: string(ProtocolOTLPHTTP)}
+
+	if err := fc.mergeInto(cfg); err != nil {
+		t.Fatalf("mergeInto returned unexpected error: %s", err)
+	}
+	if cfg.ServerURL.String() != DefaultServerURL {
+		t.Errorf("ServerURL = %q, want the explicitly-set %q to win over the file", cfg.ServerURL, DefaultServerURL)
+	}
+	if cfg.Protocol != ProtocolAPMHTTP {
+		t.Errorf("Protocol = %q, want the explicitly-set %q to win over the file", cfg.Protocol, ProtocolAPMHTTP)
+	}
+}
+
+// TestLoadFileRederivesFromBaseOnEveryReload is a regression test: loadFile
+// must merge each reload onto a fresh copy of base, not onto the result of
+// the previous reload, otherwise a field that was ever set by a reload can
+// never be changed (or reverted) by a later edit to the file.
+func TestLoadFileRederivesFromBaseOnEveryReload(t *testing.T) {
+	oldBase, oldConfig, oldExplicit := base, Config, explicitFlags
+	t.Cleanup(func() {
+		base = oldBase
+		configMu.Lock()
+		Config = oldConfig
+		configMu.Unlock()
+		explicitFlags = oldExplicit
+	})
+
+	base = configT{}
+	configMu.Lock()
+	Config = configT{}
+	configMu.Unlock()
+	explicitFlags = nil
+
+	dir := t.TempDir()
+	path := dir + "/config.json"
+
+	writeFile(t, path, `{"rewrite_ids": true, "event_rate": "100/1s"}`)
+	cfg, err := loadFile(path)
+	if err != nil {
+		t.Fatalf("loadFile: %s", err)
+	}
+	if !cfg.RewriteIDs {
+		t.Fatal("RewriteIDs = false after first reload, want true")
+	}
+	if cfg.EventRate != (RateFlag{Burst: 100, Interval: time.Second}) {
+		t.Fatalf("EventRate = %+v after first reload, want 100/1s", cfg.EventRate)
+	}
+
+	// Edit the file: turn rewrite_ids back off and change the rate. Both
+	// must take effect, not just the field that happens to still be zero.
+	writeFile(t, path, `{"rewrite_ids": false, "event_rate": "200/1s"}`)
+	cfg, err = loadFile(path)
+	if err != nil {
+		t.Fatalf("loadFile: %s", err)
+	}
+	if cfg.RewriteIDs {
+		t.Error("RewriteIDs = true after second reload, want false (file should be able to revert it)")
+	}
+	if cfg.EventRate != (RateFlag{Burst: 200, Interval: time.Second}) {
+		t.Errorf("EventRate = %+v after second reload, want 200/1s", cfg.EventRate)
+	}
+}
+
+func writeFile(t *testing.T, path, contents string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("writing %s: %s", path, err)
+	}
+}
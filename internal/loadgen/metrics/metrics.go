@@ -0,0 +1,95 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License 2.0;
+// you may not use this file except in compliance with the Elastic License 2.0.
+
+// Package metrics exposes Prometheus metrics for the load generator itself,
+// so that producer-side throughput and latency can be correlated with
+// server-side metrics scraped from the same Prometheus.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	EventsSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "apmbench",
+		Name:      "events_sent_total",
+		Help:      "Total number of events sent, by signal type.",
+	}, []string{"signal"})
+
+	BytesSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "apmbench",
+		Name:      "bytes_sent_total",
+		Help:      "Total number of bytes sent, by endpoint.",
+	}, []string{"endpoint"})
+
+	RequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "apmbench",
+		Name:      "requests_total",
+		Help:      "Total number of requests, by endpoint and HTTP status code.",
+	}, []string{"endpoint", "status"})
+
+	RequestsInFlight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "apmbench",
+		Name:      "requests_in_flight",
+		Help:      "Number of requests currently in flight, by endpoint.",
+	}, []string{"endpoint"})
+
+	RateLimitWaitSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "apmbench",
+		Name:      "rate_limit_wait_seconds",
+		Help:      "Time spent waiting on the per-signal rate limiter before sending, by signal type.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"signal"})
+)
+
+// Serve starts an HTTP server on addr exposing the registered Prometheus
+// metrics at /metrics. It returns immediately; call the returned shutdown
+// function to stop the server.
+func Serve(addr string) (shutdown func(context.Context) error, err error) {
+	if addr == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	server := &http.Server{Addr: addr, Handler: mux}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("listening on %s for metrics: %w", addr, err)
+	}
+
+	go func() {
+		if err := server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Fprintf(os.Stderr, "metrics: server on %s exited: %s\n", addr, err)
+		}
+	}()
+
+	return server.Shutdown, nil
+}
+
+// RecordRequest records the outcome of a single request against endpoint:
+// its HTTP status code and the number of bytes sent.
+func RecordRequest(endpoint string, status int, bytesSent int) {
+	RequestsTotal.WithLabelValues(endpoint, strconv.Itoa(status)).Inc()
+	BytesSent.WithLabelValues(endpoint).Add(float64(bytesSent))
+}
+
+// ObserveRateLimitWait records how long a send for signal waited on its
+// rate limiter before proceeding.
+func ObserveRateLimitWait(signal string, wait time.Duration) {
+	RateLimitWaitSeconds.WithLabelValues(signal).Observe(wait.Seconds())
+}